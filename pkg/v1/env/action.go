@@ -0,0 +1,113 @@
+package env
+
+import (
+	"fmt"
+
+	sphere "github.com/pbarker/sphere/api/gen/go/v1alpha"
+	"gorgonia.org/tensor"
+)
+
+// Action is implemented by every kind of action an Env can be Stepped
+// with. Which concrete type applies is determined by the env's action
+// space: Space_Discrete takes a DiscreteAction, Space_Box a BoxAction, and
+// Space_MultiDiscrete a MultiDiscreteAction.
+//
+// Only DiscreteAction is wired up end to end today. BoxAction and
+// MultiDiscreteAction exist so callers and VecEnv can already be written
+// against the Action interface, but StepContinuous and StepMulti return an
+// error rather than guessing at sphere.StepEnvRequest fields this module's
+// vendored sphere proto doesn't have. Wire them up once that proto carries
+// a continuous/multi-discrete action payload.
+type Action interface {
+	action()
+}
+
+// DiscreteAction selects a single option out of a Space_Discrete action
+// space.
+type DiscreteAction struct {
+	Value int
+}
+
+func (DiscreteAction) action() {}
+
+// BoxAction is a continuous action for a Space_Box action space, shaped
+// like ActionSpaceShape(). Not yet steppable; see the Action doc comment.
+type BoxAction struct {
+	Value *tensor.Dense
+}
+
+func (BoxAction) action() {}
+
+// MultiDiscreteAction selects one option per sub-space of a
+// Space_MultiDiscrete action space. Not yet steppable; see the Action doc
+// comment.
+type MultiDiscreteAction struct {
+	Values []int
+}
+
+func (MultiDiscreteAction) action() {}
+
+// Step dispatches to StepDiscrete, StepContinuous, or StepMulti based on
+// the concrete type of action.
+func (e *Env) Step(action Action) (*Outcome, error) {
+	switch a := action.(type) {
+	case DiscreteAction:
+		return e.StepDiscrete(a.Value)
+	case BoxAction:
+		return e.StepContinuous(a.Value)
+	case MultiDiscreteAction:
+		return e.StepMulti(a.Values)
+	default:
+		return nil, fmt.Errorf("unsupported action type: %T", action)
+	}
+}
+
+// StepDiscrete steps the environment with a single discrete action, for a
+// Space_Discrete action space.
+func (e *Env) StepDiscrete(value int) (*Outcome, error) {
+	req := &sphere.StepEnvRequest{Id: e.Id, Action: int32(value)}
+	return e.stepRequest(req, DiscreteAction{Value: value})
+}
+
+// StepContinuous steps the environment with a continuous action, for a
+// Space_Box action space. value must match the shape of ActionSpaceShape().
+//
+// Not yet implemented: this module's vendored sphere proto has no field on
+// StepEnvRequest to carry a continuous action, so there is nothing to send
+// it on. Validation still runs so callers catch shape mistakes early.
+func (e *Env) StepContinuous(value *tensor.Dense) (*Outcome, error) {
+	if value == nil {
+		return nil, fmt.Errorf("continuous action must not be nil")
+	}
+	if err := validateActionShape(value.Shape(), e.ActionSpaceShape()); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("continuous actions are not supported by this module's sphere dependency yet")
+}
+
+// StepMulti steps the environment with one discrete action per sub-space,
+// for a Space_MultiDiscrete action space. len(values) must match
+// ActionSpaceShape().
+//
+// Not yet implemented: this module's vendored sphere proto has no field on
+// StepEnvRequest to carry a multi-discrete action, so there is nothing to
+// send it on. Validation still runs so callers catch shape mistakes early.
+func (e *Env) StepMulti(values []int) (*Outcome, error) {
+	if err := validateActionShape([]int{len(values)}, e.ActionSpaceShape()); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("multi-discrete actions are not supported by this module's sphere dependency yet")
+}
+
+// validateActionShape checks that got matches want.
+func validateActionShape(got, want []int) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("action shape %v does not match action space shape %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return fmt.Errorf("action shape %v does not match action space shape %v", got, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package env
+
+import "testing"
+
+func TestValidateActionShape(t *testing.T) {
+	cases := []struct {
+		name    string
+		got     []int
+		want    []int
+		wantErr bool
+	}{
+		{name: "matching shape", got: []int{2, 3}, want: []int{2, 3}, wantErr: false},
+		{name: "different length", got: []int{2}, want: []int{2, 3}, wantErr: true},
+		{name: "different dims", got: []int{2, 4}, want: []int{2, 3}, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateActionShape(c.got, c.want)
+			if c.wantErr && err == nil {
+				t.Fatalf("expected an error for %v vs %v", c.got, c.want)
+			}
+			if !c.wantErr && err != nil {
+				t.Fatalf("unexpected error for %v vs %v: %s", c.got, c.want, err)
+			}
+		})
+	}
+}
@@ -9,10 +9,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pbarker/go-rl/pkg/v1/common"
 
-	"github.com/ory/dockertest"
 	"github.com/pbarker/logger"
 	sphere "github.com/pbarker/sphere/api/gen/go/v1alpha"
 	"github.com/skratchdot/open-golang/open"
@@ -22,8 +22,8 @@ import (
 
 // Server of environments.
 type Server struct {
-	// Resource is the underlying docker container.
-	Resource *dockertest.Resource
+	// Closer tears down whatever the Runtime started.
+	Closer Closer
 
 	// Client to connect to the Sphere server.
 	Client sphere.EnvironmentAPIClient
@@ -44,42 +44,53 @@ type ServerConfig struct {
 // GymServerConfig is a configuration for a OpenAI Gym server environment.
 var GymServerConfig = &ServerConfig{Image: "sphereproject/gym", Version: "latest", Port: "50051/tcp"}
 
-// NewLocalServer creates a new environment server by launching a docker container and connecting to it.
-func NewLocalServer(config *ServerConfig) (*Server, error) {
-	logger.Info("creating local server")
-	pool, err := dockertest.NewPool("")
+// NewServer creates a new environment server by starting it with the given
+// Runtime and connecting to the resulting endpoint.
+func NewServer(ctx context.Context, runtime Runtime, config *ServerConfig) (*Server, error) {
+	logger.Info("creating server")
+	endpoint, closer, err := runtime.Start(ctx, *config)
 	if err != nil {
-		return nil, fmt.Errorf("Could not connect to docker: %s", err)
+		return nil, fmt.Errorf("could not start runtime: %s", err)
 	}
 
-	resource, err := pool.Run(config.Image, config.Version, []string{})
+	client, err := dialWithRetry(ctx, endpoint.Address)
 	if err != nil {
-		return nil, fmt.Errorf("Could not start resource: %s", err)
+		return nil, fmt.Errorf("could not connect to server: %s", err)
 	}
 
-	var sphereClient sphere.EnvironmentAPIClient
+	return &Server{
+		Closer: closer,
+		Client: client,
+	}, nil
+}
 
-	// exponential backoff-retry, because the application in the container might
-	// not be ready to accept connections yet
-	if err := pool.Retry(func() error {
-		var err error
-		address := fmt.Sprintf("localhost:%s", resource.GetPort(config.Port))
-		conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
-		if err != nil {
-			return err
+// NewLocalServer creates a new environment server by launching a docker container and connecting to it.
+func NewLocalServer(config *ServerConfig) (*Server, error) {
+	return NewServer(context.Background(), DockerRuntime{}, config)
+}
+
+// dialWithRetry dials the given address with exponential backoff, since the
+// application behind it might not be ready to accept connections yet.
+func dialWithRetry(ctx context.Context, address string) (sphere.EnvironmentAPIClient, error) {
+	backoff := 500 * time.Millisecond
+	var lastErr error
+	for i := 0; i < 10; i++ {
+		conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+		if err == nil {
+			client := sphere.NewEnvironmentAPIClient(conn)
+			resp, err := client.Info(ctx, &sphere.Empty{})
+			if err == nil {
+				logger.Successf("connected to server %q", resp.ServerName)
+				return client, nil
+			}
+			lastErr = err
+		} else {
+			lastErr = err
 		}
-		sphereClient = sphere.NewEnvironmentAPIClient(conn)
-		resp, err := sphereClient.Info(context.Background(), &sphere.Empty{})
-		logger.Successf("connected to server %q", resp.ServerName)
-		return err
-	}); err != nil {
-		return nil, fmt.Errorf("Could not connect to docker: %s", err)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
-
-	return &Server{
-		Resource: resource,
-		Client:   sphereClient,
-	}, nil
+	return nil, fmt.Errorf("could not connect to %s: %s", address, lastErr)
 }
 
 // Env is a convienience environment wrapper.
@@ -94,6 +105,16 @@ type Env struct {
 
 	// Normalizer normalizes observation data.
 	Normalizer Normalizer
+
+	// hooks are the lifecycle hooks registered via RegisterHook, keyed by
+	// stage.
+	hooks map[string][]HookFunc
+
+	// episode is the number of episodes completed so far.
+	episode int
+
+	// cumulativeReward accrued over the current episode.
+	cumulativeReward float32
 }
 
 // Opt is an environment option.
@@ -120,9 +141,20 @@ func (s *Server) Make(model string, opts ...Opt) (*Env, error) {
 	for _, opt := range opts {
 		opt(e)
 	}
+	if err := e.runHooks(StageStartup, &HookContext{}); err != nil {
+		return nil, err
+	}
 	return e, nil
 }
 
+// Close tears down the environment server's runtime.
+func (s *Server) Close() error {
+	if s.Closer == nil {
+		return nil
+	}
+	return s.Closer.Close()
+}
+
 // WithNormalizer adds a normalizer for observation data.
 func WithNormalizer(normalizer Normalizer) func(*Env) {
 	return func(e *Env) {
@@ -136,8 +168,8 @@ type Outcome struct {
 	// Observation of the current state.
 	Observation *tensor.Dense
 
-	// Action that was taken
-	Action int
+	// Action that was taken.
+	Action Action
 
 	// Reward from action.
 	Reward float32
@@ -146,10 +178,17 @@ type Outcome struct {
 	Done bool
 }
 
-// Step through the environment.
-func (e *Env) Step(value int) (*Outcome, error) {
+// stepRequest sends req to the server and runs it through the step hooks,
+// tagging the resulting Outcome with action. It is the shared plumbing
+// behind StepDiscrete, StepContinuous, and StepMulti.
+func (e *Env) stepRequest(req *sphere.StepEnvRequest, action Action) (*Outcome, error) {
+	hookCtx := &HookContext{Episode: e.episode, CumulativeReward: e.cumulativeReward}
+	if err := e.runHooks(StagePreStep, hookCtx); err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
-	resp, err := e.Client.StepEnv(ctx, &sphere.StepEnvRequest{Id: e.Id, Action: int32(value)})
+	resp, err := e.Client.StepEnv(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -157,21 +196,55 @@ func (e *Env) Step(value int) (*Outcome, error) {
 	if e.Normalizer != nil {
 		observation = e.Normalizer.Norm(observation)
 	}
-	return &Outcome{observation, value, resp.Reward, resp.Done}, nil
+	outcome := &Outcome{observation, action, resp.Reward, resp.Done}
+
+	hookCtx.Outcome = outcome
+	if err := e.runHooks(StagePostStep, hookCtx); err != nil {
+		return nil, err
+	}
+
+	e.cumulativeReward += outcome.Reward
+	if outcome.Done {
+		e.episode++
+		hookCtx.Episode = e.episode
+		hookCtx.CumulativeReward = e.cumulativeReward
+		if err := e.runHooks(StageEpisodeEnd, hookCtx); err != nil {
+			return nil, err
+		}
+		e.cumulativeReward = 0
+	}
+	return outcome, nil
 }
 
-// SampleAction returns a sample action for the environment.
-func (e *Env) SampleAction() (int, error) {
+// SampleAction returns a sample action for the environment, typed to match
+// its action space (DiscreteAction, BoxAction, or MultiDiscreteAction).
+//
+// Only Space_Discrete is supported today; see the Action doc comment in
+// action.go for why Box and MultiDiscrete aren't wired up yet.
+func (e *Env) SampleAction() (Action, error) {
 	ctx := context.Background()
 	resp, err := e.Client.SampleAction(ctx, &sphere.SampleActionRequest{Id: e.Id})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	switch e.ActionSpace.GetInfo().(type) {
+	case *sphere.Space_Discrete:
+		return DiscreteAction{Value: int(resp.Value)}, nil
+	case *sphere.Space_Box:
+		return nil, fmt.Errorf("continuous action spaces are not supported by this module's sphere dependency yet")
+	case *sphere.Space_MultiDiscrete:
+		return nil, fmt.Errorf("multi-discrete action spaces are not supported by this module's sphere dependency yet")
+	default:
+		return nil, fmt.Errorf("unsupported action space type: %T", e.ActionSpace.GetInfo())
 	}
-	return int(resp.Value), nil
 }
 
 // Reset the environment.
 func (e *Env) Reset() (observation *tensor.Dense, err error) {
+	if err := e.runHooks(StagePreReset, &HookContext{Episode: e.episode, CumulativeReward: e.cumulativeReward}); err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
 	resp, err := e.Client.ResetEnv(ctx, &sphere.ResetEnvRequest{Id: e.Id})
 	if err != nil {
@@ -181,11 +254,20 @@ func (e *Env) Reset() (observation *tensor.Dense, err error) {
 	if e.Normalizer != nil {
 		observation = e.Normalizer.Norm(t)
 	}
+	e.cumulativeReward = 0
+
+	if err := e.runHooks(StagePostReset, &HookContext{Episode: e.episode}); err != nil {
+		return nil, err
+	}
 	return t, nil
 }
 
 // Close the environment.
 func (e *Env) Close() error {
+	if err := e.runHooks(StageShutdown, &HookContext{Episode: e.episode, CumulativeReward: e.cumulativeReward}); err != nil {
+		return err
+	}
+
 	ctx := context.Background()
 	resp, err := e.Client.DeleteEnv(ctx, &sphere.DeleteEnvRequest{Id: e.Id})
 	if err != nil {
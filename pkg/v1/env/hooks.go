@@ -0,0 +1,142 @@
+package env
+
+import (
+	"fmt"
+	"io"
+
+	"gorgonia.org/tensor"
+)
+
+// Hook stages, fired in this order over the lifetime of an Env:
+//
+//	Startup -> (PreReset -> PostReset -> (PreStep -> PostStep)* -> EpisodeEnd)* -> Shutdown
+const (
+	// StageStartup fires once, after an Env is constructed.
+	StageStartup = "startup"
+
+	// StagePreStep fires before an action is sent to the server.
+	StagePreStep = "pre-step"
+
+	// StagePostStep fires after an Outcome comes back from the server,
+	// before it is returned to the caller.
+	StagePostStep = "post-step"
+
+	// StagePreReset fires before a reset is sent to the server.
+	StagePreReset = "pre-reset"
+
+	// StagePostReset fires after a reset comes back from the server.
+	StagePostReset = "post-reset"
+
+	// StageEpisodeEnd fires whenever an Outcome comes back with Done set.
+	StageEpisodeEnd = "episode-end"
+
+	// StageShutdown fires once, before an Env is closed.
+	StageShutdown = "shutdown"
+)
+
+// HookContext is passed to a HookFunc and carries the state hooks are
+// allowed to read and mutate. Mutating Outcome lets a hook reshape rewards
+// or observations (reward clipping, frame-stacking); setting Outcome.Done
+// lets a hook end an episode early (a time limit).
+type HookContext struct {
+	// Outcome of the current step. Set for the post-step and episode-end
+	// stages; nil for every other stage, including pre-reset and
+	// post-reset.
+	Outcome *Outcome
+
+	// Episode is the number of episodes completed so far.
+	Episode int
+
+	// CumulativeReward accrued over the current episode.
+	CumulativeReward float32
+}
+
+// HookFunc is a single lifecycle hook. Returning an error aborts the
+// Step/Reset/Close call that triggered it.
+type HookFunc func(ctx *HookContext) error
+
+// RegisterHook adds fn to the list of hooks run at the given stage, in
+// registration order.
+func (e *Env) RegisterHook(stage string, fn HookFunc) {
+	if e.hooks == nil {
+		e.hooks = make(map[string][]HookFunc)
+	}
+	e.hooks[stage] = append(e.hooks[stage], fn)
+}
+
+// runHooks runs every hook registered for stage, in order, stopping at the
+// first error.
+func (e *Env) runHooks(stage string, ctx *HookContext) error {
+	for _, fn := range e.hooks[stage] {
+		if err := fn(ctx); err != nil {
+			return fmt.Errorf("hook %q failed: %s", stage, err)
+		}
+	}
+	return nil
+}
+
+// TimeLimit ends the episode once maxSteps steps have been taken, by
+// setting Outcome.Done on the triggering post-step call. Register it at
+// StagePostStep.
+func TimeLimit(maxSteps int) HookFunc {
+	steps := 0
+	return func(ctx *HookContext) error {
+		steps++
+		if steps >= maxSteps {
+			ctx.Outcome.Done = true
+		}
+		if ctx.Outcome.Done {
+			steps = 0
+		}
+		return nil
+	}
+}
+
+// FrameStack replaces the observation with a stack of the last k
+// observations (repeating the earliest one until k are available), along a
+// new leading dimension. Register it at StagePostStep.
+func FrameStack(k int) HookFunc {
+	var frames []*tensor.Dense
+	return func(ctx *HookContext) error {
+		frames = append(frames, ctx.Outcome.Observation)
+		if len(frames) > k {
+			frames = frames[len(frames)-k:]
+		}
+		for len(frames) < k {
+			frames = append([]*tensor.Dense{frames[0]}, frames...)
+		}
+		stacked, err := stack(frames)
+		if err != nil {
+			return err
+		}
+		ctx.Outcome.Observation = stacked
+		if ctx.Outcome.Done {
+			frames = nil
+		}
+		return nil
+	}
+}
+
+// ClipReward clamps the reward of every step to [min, max]. Register it at
+// StagePostStep.
+func ClipReward(min, max float32) HookFunc {
+	return func(ctx *HookContext) error {
+		switch {
+		case ctx.Outcome.Reward < min:
+			ctx.Outcome.Reward = min
+		case ctx.Outcome.Reward > max:
+			ctx.Outcome.Reward = max
+		}
+		return nil
+	}
+}
+
+// EpisodeMonitor writes a line with the episode number and its cumulative
+// reward to writer whenever an episode ends. Register it at
+// StageEpisodeEnd.
+func EpisodeMonitor(writer io.Writer) HookFunc {
+	return func(ctx *HookContext) error {
+		_, err := fmt.Fprintf(writer, "episode %d: reward=%.2f\n", ctx.Episode, ctx.CumulativeReward)
+		return err
+	}
+}
@@ -0,0 +1,132 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorgonia.org/tensor"
+)
+
+func TestEnv_RegisterHook_RunsInOrder(t *testing.T) {
+	e := &Env{}
+	var order []string
+	e.RegisterHook(StagePostStep, func(ctx *HookContext) error {
+		order = append(order, "first")
+		return nil
+	})
+	e.RegisterHook(StagePostStep, func(ctx *HookContext) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	if err := e.runHooks(StagePostStep, &HookContext{}); err != nil {
+		t.Fatalf("runHooks returned error: %s", err)
+	}
+	if !reflect.DeepEqual(order, []string{"first", "second"}) {
+		t.Fatalf("expected hooks to run in registration order, got %v", order)
+	}
+}
+
+func TestEnv_RunHooks_ShortCircuitsOnError(t *testing.T) {
+	e := &Env{}
+	called := false
+	e.RegisterHook(StagePostStep, func(ctx *HookContext) error {
+		return fmt.Errorf("boom")
+	})
+	e.RegisterHook(StagePostStep, func(ctx *HookContext) error {
+		called = true
+		return nil
+	})
+
+	if err := e.runHooks(StagePostStep, &HookContext{}); err == nil {
+		t.Fatal("expected an error from the failing hook")
+	}
+	if called {
+		t.Fatal("expected the second hook not to run after the first failed")
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	hook := TimeLimit(3)
+	obs := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{0}))
+
+	for i := 0; i < 2; i++ {
+		ctx := &HookContext{Outcome: &Outcome{Observation: obs}}
+		if err := hook(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ctx.Outcome.Done {
+			t.Fatalf("did not expect the episode to end after %d steps", i+1)
+		}
+	}
+
+	ctx := &HookContext{Outcome: &Outcome{Observation: obs}}
+	if err := hook(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ctx.Outcome.Done {
+		t.Fatal("expected the episode to end after reaching the time limit")
+	}
+}
+
+func TestClipReward(t *testing.T) {
+	hook := ClipReward(-1, 1)
+	cases := []struct {
+		reward float32
+		want   float32
+	}{
+		{reward: 5, want: 1},
+		{reward: -5, want: -1},
+		{reward: 0.5, want: 0.5},
+	}
+	for _, c := range cases {
+		ctx := &HookContext{Outcome: &Outcome{Reward: c.reward}}
+		if err := hook(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ctx.Outcome.Reward != c.want {
+			t.Fatalf("reward %v: expected clipped reward %v, got %v", c.reward, c.want, ctx.Outcome.Reward)
+		}
+	}
+}
+
+func TestFrameStack(t *testing.T) {
+	hook := FrameStack(2)
+	first := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{1}))
+	second := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{2}))
+
+	ctx := &HookContext{Outcome: &Outcome{Observation: first}}
+	if err := hook(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, ok := ctx.Outcome.Observation.Data().([]float32)
+	if !ok || !reflect.DeepEqual(data, []float32{1, 1}) {
+		t.Fatalf("expected the first frame repeated to fill the stack, got %v", ctx.Outcome.Observation.Data())
+	}
+
+	ctx = &HookContext{Outcome: &Outcome{Observation: second}}
+	if err := hook(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, ok = ctx.Outcome.Observation.Data().([]float32)
+	if !ok || !reflect.DeepEqual(data, []float32{1, 2}) {
+		t.Fatalf("expected the stack to contain the last 2 frames, got %v", ctx.Outcome.Observation.Data())
+	}
+}
+
+func TestEpisodeMonitor(t *testing.T) {
+	var buf bytes.Buffer
+	hook := EpisodeMonitor(&buf)
+
+	ctx := &HookContext{Episode: 3, CumulativeReward: 12.5}
+	if err := hook(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "episode 3") || !strings.Contains(out, "12.50") {
+		t.Fatalf("expected output to mention episode 3 and reward 12.50, got %q", out)
+	}
+}
@@ -0,0 +1,309 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ory/dockertest"
+	"github.com/pbarker/logger"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Endpoint is the address of a running environment server.
+type Endpoint struct {
+	// Address is a dialable "host:port" for the environment server.
+	Address string
+}
+
+// Closer tears down whatever resources a Runtime started.
+type Closer interface {
+	Close() error
+}
+
+// Runtime starts and stops the process that serves the Sphere environment
+// API, abstracting over how that process actually gets there (a local
+// docker container, a Kubernetes pod, or an already-running remote
+// instance).
+type Runtime interface {
+	// Start brings up an environment server for the given config and
+	// returns the endpoint to dial it on along with a Closer to tear it
+	// down.
+	Start(ctx context.Context, config ServerConfig) (Endpoint, Closer, error)
+}
+
+// DockerRuntime runs the environment server in a local docker container via
+// dockertest. This is the original, and still default, runtime.
+type DockerRuntime struct{}
+
+type dockerCloser struct {
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+}
+
+func (c *dockerCloser) Close() error {
+	return c.pool.Purge(c.resource)
+}
+
+// Start a docker container running the configured image.
+func (DockerRuntime) Start(ctx context.Context, config ServerConfig) (Endpoint, Closer, error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not connect to docker: %s", err)
+	}
+	resource, err := pool.Run(config.Image, config.Version, []string{})
+	if err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not start resource: %s", err)
+	}
+	address := fmt.Sprintf("localhost:%s", resource.GetPort(config.Port))
+	return Endpoint{Address: address}, &dockerCloser{pool: pool, resource: resource}, nil
+}
+
+// PodmanRuntime runs the environment server as a container managed by a
+// Podman daemon, reached over its REST socket.
+type PodmanRuntime struct {
+	// SocketPath to the Podman REST API, e.g. "/run/podman/podman.sock".
+	SocketPath string
+}
+
+type podmanCloser struct {
+	client      *http.Client
+	containerID string
+}
+
+func (c *podmanCloser) Close() error {
+	req, err := http.NewRequest(http.MethodDelete,
+		fmt.Sprintf("http://d/v4.0.0/libpod/containers/%s?force=true", c.containerID), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not remove podman container: %s", err)
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// Start a container on the Podman daemon behind PodmanRuntime's socket.
+func (p PodmanRuntime) Start(ctx context.Context, config ServerConfig) (Endpoint, Closer, error) {
+	socket := p.SocketPath
+	if socket == "" {
+		socket = "/run/podman/podman.sock"
+	}
+	port, err := parsePort(config.Port)
+	if err != nil {
+		return Endpoint{}, nil, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	createResp, err := client.Post("http://d/v4.0.0/libpod/containers/create", "application/json",
+		podmanCreateBody(config, port))
+	if err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not reach podman socket %q: %s", socket, err)
+	}
+	containerID, err := decodePodmanID(createResp)
+	if err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not create podman container: %s", err)
+	}
+
+	startReq, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://d/v4.0.0/libpod/containers/%s/start", containerID), nil)
+	if err != nil {
+		return Endpoint{}, nil, err
+	}
+	startResp, err := client.Do(startReq)
+	if err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not start podman container: %s", err)
+	}
+	defer startResp.Body.Close()
+	if startResp.StatusCode >= 300 {
+		return Endpoint{}, nil, fmt.Errorf("could not start podman container: server returned status %d", startResp.StatusCode)
+	}
+
+	address := fmt.Sprintf("localhost:%d", port)
+	return Endpoint{Address: address}, &podmanCloser{client: client, containerID: containerID}, nil
+}
+
+// KubernetesRuntime runs the environment server as a Pod, fronted by a
+// Service, in a Kubernetes cluster.
+type KubernetesRuntime struct {
+	// Clientset to talk to the Kubernetes API. If nil, an in-cluster
+	// config is used.
+	Clientset kubernetes.Interface
+
+	// Namespace to create the Pod and Service in.
+	Namespace string
+}
+
+type kubernetesCloser struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (c *kubernetesCloser) Close() error {
+	background := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &background}
+
+	var errs []string
+	if err := c.clientset.CoreV1().Pods(c.namespace).Delete(context.Background(), c.name, opts); err != nil {
+		errs = append(errs, fmt.Sprintf("could not delete pod %q: %s", c.name, err))
+	}
+	if err := c.clientset.CoreV1().Services(c.namespace).Delete(context.Background(), c.name, opts); err != nil {
+		errs = append(errs, fmt.Sprintf("could not delete service %q: %s", c.name, err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Start a Pod+Service for the configured image and return its in-cluster DNS
+// name.
+func (k KubernetesRuntime) Start(ctx context.Context, config ServerConfig) (Endpoint, Closer, error) {
+	clientset := k.Clientset
+	if clientset == nil {
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return Endpoint{}, nil, fmt.Errorf("could not load in-cluster config: %s", err)
+		}
+		clientset, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return Endpoint{}, nil, fmt.Errorf("could not create kubernetes client: %s", err)
+		}
+	}
+	namespace := k.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	name := fmt.Sprintf("sphere-%d", time.Now().UnixNano())
+	labels := map[string]string{"app": name}
+
+	port, err := parsePort(config.Port)
+	if err != nil {
+		return Endpoint{}, nil, err
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:  "sphere",
+					Image: fmt.Sprintf("%s:%s", config.Image, config.Version),
+					Ports: []v1.ContainerPort{{ContainerPort: int32(port)}},
+				},
+			},
+		},
+	}
+	if _, err := clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not create pod: %s", err)
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1.ServiceSpec{
+			Selector: labels,
+			Ports:    []v1.ServicePort{{Port: int32(port), TargetPort: intOrString(port)}},
+		},
+	}
+	if _, err := clientset.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{}); err != nil {
+		return Endpoint{}, nil, fmt.Errorf("could not create service: %s", err)
+	}
+
+	address := fmt.Sprintf("%s.%s.svc.cluster.local:%d", name, namespace, port)
+	return Endpoint{Address: address}, &kubernetesCloser{clientset: clientset, namespace: namespace, name: name}, nil
+}
+
+// podmanCreateBody builds the request body for the Podman "create
+// container" endpoint from a ServerConfig, publishing port on the host at
+// the same number it is exposed on in the container.
+func podmanCreateBody(config ServerConfig, port int) *bytes.Reader {
+	body, _ := json.Marshal(map[string]interface{}{
+		"image": fmt.Sprintf("%s:%s", config.Image, config.Version),
+		"portmappings": []map[string]interface{}{
+			{
+				"container_port": port,
+				"host_port":      port,
+				"protocol":       "tcp",
+			},
+		},
+	})
+	return bytes.NewReader(body)
+}
+
+// decodePodmanID pulls the container id out of a Podman "create container"
+// response.
+func decodePodmanID(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("podman response had no container id")
+	}
+	return created.ID, nil
+}
+
+// parsePort extracts the numeric port from a ServerConfig.Port value such
+// as "50051/tcp".
+func parsePort(port string) (int, error) {
+	p := strings.SplitN(port, "/", 2)[0]
+	n, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse port %q: %s", port, err)
+	}
+	return n, nil
+}
+
+// intOrString wraps a port as the IntOrString type expected by the
+// Kubernetes API.
+func intOrString(port int) intstr.IntOrString {
+	return intstr.FromInt(port)
+}
+
+// RemoteRuntime skips container management entirely and dials an
+// already-running environment server, e.g. one shared across a GPU cluster
+// where launching containers from within a Go process isn't allowed.
+type RemoteRuntime struct {
+	// Address is the "host:port" of the running environment server.
+	Address string
+}
+
+type noopCloser struct{}
+
+func (noopCloser) Close() error { return nil }
+
+// Start returns the configured address unchanged; there is nothing to tear
+// down on Close.
+func (r RemoteRuntime) Start(ctx context.Context, config ServerConfig) (Endpoint, Closer, error) {
+	if r.Address == "" {
+		return Endpoint{}, nil, fmt.Errorf("remote runtime requires an address")
+	}
+	logger.Infof("using remote environment server at %s", r.Address)
+	return Endpoint{Address: r.Address}, noopCloser{}, nil
+}
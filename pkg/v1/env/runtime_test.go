@@ -0,0 +1,82 @@
+package env
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParsePort(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "50051/tcp", want: 50051},
+		{in: "50051", want: 50051},
+		{in: "not-a-port", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parsePort(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("parsePort(%q): expected an error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parsePort(%q): unexpected error: %s", c.in, err)
+		}
+		if got != c.want {
+			t.Fatalf("parsePort(%q): expected %d, got %d", c.in, c.want, got)
+		}
+	}
+}
+
+func TestPodmanCreateBody(t *testing.T) {
+	config := ServerConfig{Image: "sphereproject/gym", Version: "latest", Port: "50051/tcp"}
+	body := podmanCreateBody(config, 50051)
+
+	var decoded struct {
+		Image        string `json:"image"`
+		PortMappings []struct {
+			ContainerPort int    `json:"container_port"`
+			HostPort      int    `json:"host_port"`
+			Protocol      string `json:"protocol"`
+		} `json:"portmappings"`
+	}
+	if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+		t.Fatalf("could not decode create body: %s", err)
+	}
+
+	if decoded.Image != "sphereproject/gym:latest" {
+		t.Fatalf("expected image %q, got %q", "sphereproject/gym:latest", decoded.Image)
+	}
+	if len(decoded.PortMappings) != 1 {
+		t.Fatalf("expected exactly one portmapping, got %d", len(decoded.PortMappings))
+	}
+	pm := decoded.PortMappings[0]
+	if pm.ContainerPort != 50051 || pm.HostPort != 50051 || pm.Protocol != "tcp" {
+		t.Fatalf("expected portmapping {50051 50051 tcp}, got %+v", pm)
+	}
+}
+
+func TestDecodePodmanID(t *testing.T) {
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"Id":"abc123"}`))}
+	id, err := decodePodmanID(resp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if id != "abc123" {
+		t.Fatalf("expected id %q, got %q", "abc123", id)
+	}
+}
+
+func TestDecodePodmanID_MissingID(t *testing.T) {
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{}`))}
+	if _, err := decodePodmanID(resp); err == nil {
+		t.Fatal("expected an error when the response has no container id")
+	}
+}
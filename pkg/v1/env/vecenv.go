@@ -0,0 +1,315 @@
+package env
+
+import (
+	"fmt"
+	"sync"
+
+	sphere "github.com/pbarker/sphere/api/gen/go/v1alpha"
+	"gorgonia.org/tensor"
+)
+
+// VecEnv manages a fixed number of environments that are stepped concurrently,
+// exposing batched Reset/Step/SampleAction so actor-learner algorithms (A2C,
+// PPO, IMPALA) can train on stacked observations instead of looping in the
+// caller. Step and SampleAction pass Action values through to each sub-env's
+// Step and SampleAction, so only DiscreteAction actions on a Space_Discrete
+// action space succeed; BoxAction and MultiDiscreteAction return an error
+// (see the Action doc comment).
+type VecEnv struct {
+	// Envs are the underlying sub-environments, in batch order.
+	Envs []*Env
+
+	// Client to connect to the Sphere server, shared by all sub-envs.
+	Client sphere.EnvironmentAPIClient
+
+	// Normalizer normalizes observation data, shared across sub-envs.
+	Normalizer Normalizer
+}
+
+// SyncVecEnv is a VecEnv that steps its sub-environments sequentially rather
+// than concurrently. It is slower than VecEnv but deterministic, which makes
+// it suitable for tests and debugging.
+type SyncVecEnv struct {
+	*VecEnv
+}
+
+// VecOutcome is the batched result of stepping or resetting a VecEnv.
+type VecOutcome struct {
+	// Observation is the stacked observation, with a leading batch dimension.
+	Observation *tensor.Dense
+
+	// Action is the batched action that was taken, one per env.
+	Action []Action
+
+	// Reward is the per-env reward from the action.
+	Reward []float32
+
+	// Done is the per-env done flag.
+	Done []bool
+
+	// Info carries the terminal observation for any env that was
+	// auto-reset this step, keyed by env index.
+	Info map[int]*tensor.Dense
+}
+
+// MakeVec creates a VecEnv of n environments backed by a single gRPC
+// connection, sharing a Normalizer across sub-envs.
+func (s *Server) MakeVec(model string, n int, opts ...Opt) (*VecEnv, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("n must be greater than 0, got %d", n)
+	}
+	v := &VecEnv{
+		Envs:   make([]*Env, n),
+		Client: s.Client,
+	}
+	for i := 0; i < n; i++ {
+		e, err := s.Make(model, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not create sub-env %d: %s", i, err)
+		}
+		v.Envs[i] = e
+		if v.Normalizer == nil {
+			v.Normalizer = e.Normalizer
+		} else {
+			e.Normalizer = v.Normalizer
+		}
+	}
+	return v, nil
+}
+
+// MakeSyncVec creates a SyncVecEnv of n environments backed by a single gRPC
+// connection.
+func (s *Server) MakeSyncVec(model string, n int, opts ...Opt) (*SyncVecEnv, error) {
+	v, err := s.MakeVec(model, n, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncVecEnv{v}, nil
+}
+
+// Len is the number of sub-environments.
+func (v *VecEnv) Len() int {
+	return len(v.Envs)
+}
+
+// Reset all sub-environments concurrently and return the stacked observation.
+func (v *VecEnv) Reset() (*tensor.Dense, error) {
+	observations := make([]*tensor.Dense, v.Len())
+	errs := make([]error, v.Len())
+	var wg sync.WaitGroup
+	for i, e := range v.Envs {
+		wg.Add(1)
+		go func(i int, e *Env) {
+			defer wg.Done()
+			observations[i], errs[i] = e.Reset()
+		}(i, e)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not reset sub-env %d: %s", i, err)
+		}
+	}
+	return stack(observations)
+}
+
+// Reset all sub-environments in order and return the stacked observation.
+func (v *SyncVecEnv) Reset() (*tensor.Dense, error) {
+	observations := make([]*tensor.Dense, v.Len())
+	for i, e := range v.Envs {
+		observation, err := e.Reset()
+		if err != nil {
+			return nil, fmt.Errorf("could not reset sub-env %d: %s", i, err)
+		}
+		observations[i] = observation
+	}
+	return stack(observations)
+}
+
+// autoReset resolves the observation to report for a sub-env that just
+// stepped, and the terminal observation to stash in Info if its episode
+// ended. It is the shared accounting behind VecEnv.Step and
+// SyncVecEnv.Step, kept as a pure function so it can be unit tested without
+// a live sphere server.
+func autoReset(outcome *Outcome, resetObservation *tensor.Dense) (observation, terminal *tensor.Dense) {
+	if !outcome.Done {
+		return outcome.Observation, nil
+	}
+	return resetObservation, outcome.Observation
+}
+
+// Step all sub-environments concurrently with the batched actions, one per
+// sub-env. Any sub-env that finishes its episode is auto-reset, with the
+// terminal observation stashed in the returned Info map.
+func (v *VecEnv) Step(actions []Action) (*VecOutcome, error) {
+	if len(actions) != v.Len() {
+		return nil, fmt.Errorf("expected %d actions, got %d", v.Len(), len(actions))
+	}
+	observations := make([]*tensor.Dense, v.Len())
+	rewards := make([]float32, v.Len())
+	dones := make([]bool, v.Len())
+	errs := make([]error, v.Len())
+	info := make(map[int]*tensor.Dense)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, e := range v.Envs {
+		wg.Add(1)
+		go func(i int, e *Env, action Action) {
+			defer wg.Done()
+			outcome, err := e.Step(action)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			rewards[i] = outcome.Reward
+			dones[i] = outcome.Done
+			if !outcome.Done {
+				observations[i] = outcome.Observation
+				return
+			}
+			reset, err := e.Reset()
+			if err != nil {
+				errs[i] = fmt.Errorf("could not auto-reset sub-env %d: %s", i, err)
+				return
+			}
+			observation, terminal := autoReset(outcome, reset)
+			observations[i] = observation
+			mu.Lock()
+			info[i] = terminal
+			mu.Unlock()
+		}(i, e, actions[i])
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not step sub-env %d: %s", i, err)
+		}
+	}
+	stacked, err := stack(observations)
+	if err != nil {
+		return nil, err
+	}
+	return &VecOutcome{
+		Observation: stacked,
+		Action:      actions,
+		Reward:      rewards,
+		Done:        dones,
+		Info:        info,
+	}, nil
+}
+
+// Step all sub-environments in order with the batched actions, one per
+// sub-env. Any sub-env that finishes its episode is auto-reset, with the
+// terminal observation stashed in the returned Info map.
+func (v *SyncVecEnv) Step(actions []Action) (*VecOutcome, error) {
+	if len(actions) != v.Len() {
+		return nil, fmt.Errorf("expected %d actions, got %d", v.Len(), len(actions))
+	}
+	observations := make([]*tensor.Dense, v.Len())
+	rewards := make([]float32, v.Len())
+	dones := make([]bool, v.Len())
+	info := make(map[int]*tensor.Dense)
+	for i, e := range v.Envs {
+		outcome, err := e.Step(actions[i])
+		if err != nil {
+			return nil, fmt.Errorf("could not step sub-env %d: %s", i, err)
+		}
+		rewards[i] = outcome.Reward
+		dones[i] = outcome.Done
+		if !outcome.Done {
+			observations[i] = outcome.Observation
+			continue
+		}
+		reset, err := e.Reset()
+		if err != nil {
+			return nil, fmt.Errorf("could not auto-reset sub-env %d: %s", i, err)
+		}
+		observation, terminal := autoReset(outcome, reset)
+		observations[i] = observation
+		info[i] = terminal
+	}
+	stacked, err := stack(observations)
+	if err != nil {
+		return nil, err
+	}
+	return &VecOutcome{
+		Observation: stacked,
+		Action:      actions,
+		Reward:      rewards,
+		Done:        dones,
+		Info:        info,
+	}, nil
+}
+
+// SampleAction returns a batch of sample actions, one per sub-env, sampled
+// concurrently.
+func (v *VecEnv) SampleAction() ([]Action, error) {
+	actions := make([]Action, v.Len())
+	errs := make([]error, v.Len())
+	var wg sync.WaitGroup
+	for i, e := range v.Envs {
+		wg.Add(1)
+		go func(i int, e *Env) {
+			defer wg.Done()
+			actions[i], errs[i] = e.SampleAction()
+		}(i, e)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not sample action for sub-env %d: %s", i, err)
+		}
+	}
+	return actions, nil
+}
+
+// SampleAction returns a batch of sample actions, one per sub-env, sampled in
+// order.
+func (v *SyncVecEnv) SampleAction() ([]Action, error) {
+	actions := make([]Action, v.Len())
+	for i, e := range v.Envs {
+		action, err := e.SampleAction()
+		if err != nil {
+			return nil, fmt.Errorf("could not sample action for sub-env %d: %s", i, err)
+		}
+		actions[i] = action
+	}
+	return actions, nil
+}
+
+// Close all sub-environments concurrently.
+func (v *VecEnv) Close() error {
+	errs := make([]error, v.Len())
+	var wg sync.WaitGroup
+	for i, e := range v.Envs {
+		wg.Add(1)
+		go func(i int, e *Env) {
+			defer wg.Done()
+			errs[i] = e.Close()
+		}(i, e)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("could not close sub-env %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// stack combines the per-env observations into a single dense tensor with a
+// leading batch dimension.
+func stack(observations []*tensor.Dense) (*tensor.Dense, error) {
+	if len(observations) == 0 {
+		return nil, fmt.Errorf("no observations to stack")
+	}
+	stacked, err := tensor.Stack(0, observations[0], observations[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("could not stack observations: %s", err)
+	}
+	dense, ok := stacked.(*tensor.Dense)
+	if !ok {
+		return nil, fmt.Errorf("expected stacked observations to be a dense tensor")
+	}
+	return dense, nil
+}
@@ -0,0 +1,62 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"gorgonia.org/tensor"
+)
+
+func TestStack(t *testing.T) {
+	a := tensor.New(tensor.WithShape(2), tensor.WithBacking([]float32{1, 2}))
+	b := tensor.New(tensor.WithShape(2), tensor.WithBacking([]float32{3, 4}))
+
+	stacked, err := stack([]*tensor.Dense{a, b})
+	if err != nil {
+		t.Fatalf("stack returned error: %s", err)
+	}
+	if !reflect.DeepEqual(stacked.Shape(), tensor.Shape{2, 2}) {
+		t.Fatalf("expected shape [2 2], got %v", stacked.Shape())
+	}
+	got, ok := stacked.Data().([]float32)
+	if !ok {
+		t.Fatalf("expected []float32 data, got %T", stacked.Data())
+	}
+	want := []float32{1, 2, 3, 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestStack_Empty(t *testing.T) {
+	if _, err := stack(nil); err == nil {
+		t.Fatal("expected an error stacking zero observations")
+	}
+}
+
+func TestAutoReset_NotDone(t *testing.T) {
+	obs := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{1}))
+	outcome := &Outcome{Observation: obs, Done: false}
+
+	observation, terminal := autoReset(outcome, nil)
+	if observation != obs {
+		t.Fatal("expected the outcome's own observation when not done")
+	}
+	if terminal != nil {
+		t.Fatal("expected no terminal observation when not done")
+	}
+}
+
+func TestAutoReset_Done(t *testing.T) {
+	terminalObs := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{9}))
+	resetObs := tensor.New(tensor.WithShape(1), tensor.WithBacking([]float32{0}))
+	outcome := &Outcome{Observation: terminalObs, Done: true}
+
+	observation, terminal := autoReset(outcome, resetObs)
+	if observation != resetObs {
+		t.Fatal("expected the freshly reset observation when done")
+	}
+	if terminal != terminalObs {
+		t.Fatal("expected the pre-reset observation to be stashed as terminal")
+	}
+}